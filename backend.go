@@ -0,0 +1,214 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	vision "cloud.google.com/go/vision/apiv1"
+	"golang.org/x/net/context"
+	visionpb "google.golang.org/genproto/googleapis/cloud/vision/v1"
+)
+
+// Supported values for -backend.
+const (
+	backendGoogle    = "google"
+	backendTesseract = "tesseract"
+	backendTextract  = "textract"
+)
+
+// OCRBackend detects text in an image. Implementations wrap a specific OCR
+// engine or cloud API behind a single, neutral interface.
+type OCRBackend interface {
+	Detect(ctx context.Context, r io.Reader) ([]TextAnnotation, error)
+}
+
+// TextAnnotation is a single piece of detected text, normalized across OCR
+// backends. Page is the 1-based page the annotation belongs to, since a
+// single Detect call can cover a multi-page input (e.g. a multi-page
+// TIFF). Within a page, and following the Cloud Vision API, the first
+// annotation of that page is the page's full text block and the rest are
+// the individual words it was split into; every OCRBackend implementation
+// is responsible for upholding this (see withAggregate for backends whose
+// underlying engine only reports individual words).
+type TextAnnotation struct {
+	Description string      `json:"description"`
+	Locale      string      `json:"locale,omitempty"`
+	Confidence  float32     `json:"confidence,omitempty"`
+	BoundingBox BoundingBox `json:"boundingBox"`
+	Page        int         `json:"page"`
+}
+
+// BoundingBox is the polygon enclosing a TextAnnotation, in image pixel
+// coordinates.
+type BoundingBox struct {
+	Vertices []Point `json:"vertices,omitempty"`
+}
+
+// Point is a single vertex of a BoundingBox.
+type Point struct {
+	X int32 `json:"x"`
+	Y int32 `json:"y"`
+}
+
+// withAggregate prepends the whole-text aggregate entry documented on
+// TextAnnotation to words, for backends (tesseract, textract) whose
+// underlying engine only reports individual words. It reproduces the shape
+// of what Cloud Vision already gives us, so that every backend's Detect
+// result has the same aggregate-first shape. words must all belong to the
+// same page; use withAggregatePerPage for multi-page results.
+func withAggregate(words []TextAnnotation) []TextAnnotation {
+	if len(words) == 0 {
+		return words
+	}
+	texts := make([]string, len(words))
+	var vertices []Point
+	for i, w := range words {
+		texts[i] = w.Description
+		vertices = append(vertices, w.BoundingBox.Vertices...)
+	}
+	aggregate := TextAnnotation{
+		Description: strings.Join(texts, " "),
+		BoundingBox: enclosingBox(vertices),
+		Page:        words[0].Page,
+	}
+	return append([]TextAnnotation{aggregate}, words...)
+}
+
+// withAggregatePerPage groups words by their Page and runs withAggregate
+// over each page independently, so a multi-page Detect result gets one
+// aggregate per page instead of a single aggregate spanning pages whose
+// bounding boxes are in unrelated, page-local coordinate systems.
+func withAggregatePerPage(words []TextAnnotation) []TextAnnotation {
+	if len(words) == 0 {
+		return words
+	}
+	var pageOrder []int
+	byPage := map[int][]TextAnnotation{}
+	for _, w := range words {
+		if _, ok := byPage[w.Page]; !ok {
+			pageOrder = append(pageOrder, w.Page)
+		}
+		byPage[w.Page] = append(byPage[w.Page], w)
+	}
+	var out []TextAnnotation
+	for _, page := range pageOrder {
+		out = append(out, withAggregate(byPage[page])...)
+	}
+	return out
+}
+
+// enclosingBox returns the smallest axis-aligned BoundingBox containing
+// all of vertices.
+func enclosingBox(vertices []Point) BoundingBox {
+	minX, minY, maxX, maxY, ok := minMax(vertices)
+	if !ok {
+		return BoundingBox{}
+	}
+	return BoundingBox{Vertices: []Point{
+		{X: minX, Y: minY},
+		{X: maxX, Y: minY},
+		{X: maxX, Y: maxY},
+		{X: minX, Y: maxY},
+	}}
+}
+
+// minMax returns the bounding coordinates of vertices. ok is false when
+// vertices is empty.
+func minMax(vertices []Point) (minX, minY, maxX, maxY int32, ok bool) {
+	if len(vertices) == 0 {
+		return 0, 0, 0, 0, false
+	}
+	minX, minY = vertices[0].X, vertices[0].Y
+	maxX, maxY = vertices[0].X, vertices[0].Y
+	for _, v := range vertices[1:] {
+		if v.X < minX {
+			minX = v.X
+		}
+		if v.Y < minY {
+			minY = v.Y
+		}
+		if v.X > maxX {
+			maxX = v.X
+		}
+		if v.Y > maxY {
+			maxY = v.Y
+		}
+	}
+	return minX, minY, maxX, maxY, true
+}
+
+// newBackend returns the OCRBackend selected by -backend.
+func newBackend(ctx context.Context) (OCRBackend, error) {
+	switch *flagBackend {
+	case backendGoogle:
+		return newGoogleBackend(ctx)
+	case backendTesseract:
+		return newTesseractBackend()
+	case backendTextract:
+		return newTextractBackend(ctx)
+	default:
+		return nil, fmt.Errorf("unknown -backend %q: must be one of %s, %s, %s",
+			*flagBackend, backendGoogle, backendTesseract, backendTextract)
+	}
+}
+
+// googleBackend is the OCRBackend backed by the Cloud Vision API.
+type googleBackend struct {
+	cl *vision.ImageAnnotatorClient
+}
+
+func newGoogleBackend(ctx context.Context) (OCRBackend, error) {
+	cl, err := visionClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &googleBackend{cl: cl}, nil
+}
+
+func (b *googleBackend) Detect(ctx context.Context, r io.Reader) ([]TextAnnotation, error) {
+	image, err := vision.NewImageFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	texts, err := b.cl.DetectTexts(ctx, image, nil, -1)
+	if err != nil {
+		return nil, err
+	}
+	anns := make([]TextAnnotation, len(texts))
+	for i, t := range texts {
+		anns[i] = textAnnotationFromEntity(t)
+	}
+	return anns, nil
+}
+
+func textAnnotationFromEntity(t *visionpb.EntityAnnotation) TextAnnotation {
+	ann := TextAnnotation{
+		Description: t.Description,
+		Locale:      t.Locale,
+		Confidence:  t.Confidence,
+		Page:        1,
+	}
+	if t.BoundingPoly != nil {
+		for _, v := range t.BoundingPoly.Vertices {
+			ann.BoundingBox.Vertices = append(ann.BoundingBox.Vertices, Point{X: v.X, Y: v.Y})
+		}
+	}
+	return ann
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Supported output formats for -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputHOCR = "hocr"
+)
+
+// imageExts are the file extensions walked for when -input is a directory.
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".tif":  true,
+	".tiff": true,
+	".pdf":  true,
+}
+
+// ocrResult is the per-file record produced by a batch run, split into one
+// pageResult per page so a multi-page input (e.g. a multi-page TIFF) keeps
+// each page's words and bounding boxes separate instead of flattening them
+// into a single, page-colliding list.
+type ocrResult struct {
+	File  string       `json:"file"`
+	Pages []pageResult `json:"pages"`
+}
+
+// pageResult is the annotations belonging to a single, 1-based page of an
+// ocrResult.
+type pageResult struct {
+	Page        int              `json:"page"`
+	Annotations []TextAnnotation `json:"annotations"`
+}
+
+// groupPages buckets anns by their Page field, preserving the order pages
+// are first seen in, so a flat Detect result can be rendered and written
+// out one page at a time.
+func groupPages(anns []TextAnnotation) []pageResult {
+	var pageOrder []int
+	byPage := map[int][]TextAnnotation{}
+	for _, a := range anns {
+		if _, ok := byPage[a.Page]; !ok {
+			pageOrder = append(pageOrder, a.Page)
+		}
+		byPage[a.Page] = append(byPage[a.Page], a)
+	}
+	pages := make([]pageResult, len(pageOrder))
+	for i, p := range pageOrder {
+		pages[i] = pageResult{Page: p, Annotations: byPage[p]}
+	}
+	return pages
+}
+
+// listImages expands input into the list of image files to OCR. input may
+// be a single file, a directory to walk recursively, or a glob pattern.
+func listImages(input string) ([]string, error) {
+	if strings.ContainsAny(input, "*?[") {
+		return filepath.Glob(input)
+	}
+	fi, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{input}, nil
+	}
+	var files []string
+	err = filepath.Walk(input, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if imageExts[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// runBatch OCRs files with up to concurrency workers at a time and writes
+// the results to stdout in the given format.
+func runBatch(ctx context.Context, backend OCRBackend, files []string, concurrency int, format string) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*ocrResult, len(files))
+	errs := make([]error, len(files))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, path := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			anns, err := detectFile(ctx, backend, path)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %v", path, err)
+				return
+			}
+			results[i] = &ocrResult{File: path, Pages: groupPages(anns)}
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+
+	switch format {
+	case outputHOCR:
+		return writeHOCRDocument(os.Stdout, results)
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, res := range results {
+			if res == nil {
+				continue
+			}
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, res := range results {
+			if res == nil {
+				continue
+			}
+			writeText(os.Stdout, res)
+		}
+	}
+	return nil
+}
+
+// detectFile returns the text annotations for the image at path, serving
+// them from the on-disk cache when available.
+func detectFile(ctx context.Context, backend OCRBackend, path string) ([]TextAnnotation, error) {
+	key, err := fileCacheKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if anns, ok := loadCached(key); ok {
+		return anns, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	anns, err := backend.Detect(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	saveCached(key, anns)
+	return anns, nil
+}
+
+func writeText(w io.Writer, res *ocrResult) {
+	fmt.Fprintf(w, "==> %s <==\n", res.File)
+	for _, page := range res.Pages {
+		for _, a := range page.Annotations {
+			fmt.Fprintln(w, a.Description)
+		}
+	}
+}
+
+// writeHOCRDocument writes a single hOCR document with one ocr_page per
+// page of every successfully processed file.
+func writeHOCRDocument(w io.Writer, results []*ocrResult) error {
+	if _, err := io.WriteString(w, hocrHeader); err != nil {
+		return err
+	}
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		for _, page := range res.Pages {
+			writeHOCRPage(w, res.File, page)
+		}
+	}
+	_, err := io.WriteString(w, hocrFooter)
+	return err
+}
+
+const hocrHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en">
+<head>
+<title>ocr hOCR output</title>
+<meta http-equiv="Content-Type" content="text/html;charset=utf-8" />
+<meta name="ocr-system" content="mpl/ocr" />
+<meta name="ocr-capabilities" content="ocr_page ocr_par ocr_line ocrx_word" />
+</head>
+<body>
+`
+
+const hocrFooter = `</body>
+</html>
+`
+
+// writeHOCRPage writes the ocr_page div for a single page of file, using
+// page.Page to keep the id and title unique and meaningful across a
+// multi-page input.
+func writeHOCRPage(w io.Writer, file string, page pageResult) {
+	fmt.Fprintf(w, "<div class=\"ocr_page\" id=\"page_%s_%d\" title=\"image %s; page %d\">\n",
+		html.EscapeString(sanitizeID(file)), page.Page, html.EscapeString(file), page.Page)
+	if words := hocrWords(page.Annotations); len(words) > 0 {
+		fmt.Fprint(w, "<p class=\"ocr_par\">\n<span class=\"ocr_line\">\n")
+		for _, a := range words {
+			fmt.Fprintf(w, "<span class=\"ocrx_word\" title=\"bbox %s; x_wconf %d\">%s</span>\n",
+				bboxString(a.BoundingBox), int(a.Confidence*100), html.EscapeString(a.Description))
+		}
+		fmt.Fprint(w, "</span>\n</p>\n")
+	}
+	fmt.Fprint(w, "</div>\n")
+}
+
+// hocrWords returns the word-level annotations to render as ocrx_word
+// spans. When there's more than one annotation, the first is the
+// full-text aggregate and is dropped; a single annotation is rendered as
+// itself, since it's both the aggregate and the only word recognized.
+func hocrWords(anns []TextAnnotation) []TextAnnotation {
+	if len(anns) > 1 {
+		return anns[1:]
+	}
+	return anns
+}
+
+// bboxString formats a bounding box as the "x0 y0 x1 y1" form hOCR's bbox
+// property expects.
+func bboxString(box BoundingBox) string {
+	minX, minY, maxX, maxY, ok := minMax(box.Vertices)
+	if !ok {
+		return "0 0 0 0"
+	}
+	return fmt.Sprintf("%d %d %d %d", minX, minY, maxX, maxY)
+}
+
+func sanitizeID(path string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", " ", "_", ".", "_").Replace(path)
+}
+
+// cacheDir returns (creating it if necessary) the directory OCR results
+// are cached in across runs.
+func cacheDir() (string, error) {
+	dir := filepath.Join("credentials", "ocr-cache")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// fileCacheKey returns the cache key for path: the SHA-256 of its contents
+// plus the request parameters that affect the OCR result, so that re-runs
+// with the same image, backend and credentials skip doing the OCR again.
+func fileCacheKey(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(data)
+	fmt.Fprintf(h, "|backend=%s|service_account=%s|client_id=%s", *flagBackend, *flagServiceAccount, *flagClientID)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadCached(key string) ([]TextAnnotation, bool) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, false
+	}
+	f, err := os.Open(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var anns []TextAnnotation
+	if err := json.NewDecoder(f).Decode(&anns); err != nil {
+		return nil, false
+	}
+	return anns, true
+}
+
+func saveCached(key string, anns []TextAnnotation) {
+	dir, err := cacheDir()
+	if err != nil {
+		log.Printf("warning: unable to cache OCR result: %v", err)
+		return
+	}
+	f, err := os.Create(filepath.Join(dir, key+".json"))
+	if err != nil {
+		log.Printf("warning: unable to cache OCR result: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(anns); err != nil {
+		log.Printf("warning: unable to cache OCR result: %v", err)
+	}
+}
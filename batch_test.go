@@ -0,0 +1,185 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestListImagesWalksDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.jpg", "b.PNG", "c.txt", filepath.Join("sub", "d.tif")} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := listImages(dir)
+	if err != nil {
+		t.Fatalf("listImages(%q): %v", dir, err)
+	}
+	sort.Strings(got)
+	want := []string{
+		filepath.Join(dir, "a.jpg"),
+		filepath.Join(dir, "b.PNG"),
+		filepath.Join(dir, "sub", "d.tif"),
+	}
+	sort.Strings(want)
+	if !equalStrings(got, want) {
+		t.Errorf("listImages(%q) = %v, want %v", dir, got, want)
+	}
+}
+
+func TestListImagesSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(p, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := listImages(p)
+	if err != nil {
+		t.Fatalf("listImages(%q): %v", p, err)
+	}
+	if len(got) != 1 || got[0] != p {
+		t.Errorf("listImages(%q) = %v, want [%s]", p, got, p)
+	}
+}
+
+func TestListImagesGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.jpg", "b.png"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := listImages(filepath.Join(dir, "*.jpg"))
+	if err != nil {
+		t.Fatalf("listImages(glob): %v", err)
+	}
+	if len(got) != 1 || filepath.Base(got[0]) != "a.jpg" {
+		t.Errorf("listImages(glob) = %v, want [a.jpg]", got)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBboxString(t *testing.T) {
+	tests := []struct {
+		name string
+		box  BoundingBox
+		want string
+	}{
+		{"empty", BoundingBox{}, "0 0 0 0"},
+		{"single vertex", BoundingBox{Vertices: []Point{{X: 5, Y: 7}}}, "5 7 5 7"},
+		{
+			"rectangle",
+			BoundingBox{Vertices: []Point{{X: 10, Y: 20}, {X: 30, Y: 20}, {X: 30, Y: 40}, {X: 10, Y: 40}}},
+			"10 20 30 40",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bboxString(tt.box); got != tt.want {
+				t.Errorf("bboxString(%+v) = %q, want %q", tt.box, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHOCRPageSingleAnnotation(t *testing.T) {
+	// Regression test: a Detect result with a single TextAnnotation (no
+	// leading aggregate entry) must still render its text, not be
+	// silently dropped by Annotations[1:].
+	page := pageResult{
+		Page: 1,
+		Annotations: []TextAnnotation{
+			{Description: "hello", BoundingBox: BoundingBox{Vertices: []Point{
+				{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10},
+			}}},
+		},
+	}
+	var buf bytes.Buffer
+	writeHOCRPage(&buf, "one.png", page)
+	if !strings.Contains(buf.String(), "hello") {
+		t.Errorf("writeHOCRPage dropped the only annotation, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteHOCRPageAggregateThenWords(t *testing.T) {
+	page := pageResult{
+		Page: 1,
+		Annotations: []TextAnnotation{
+			{Description: "hello world"},
+			{Description: "hello"},
+			{Description: "world"},
+		},
+	}
+	var buf bytes.Buffer
+	writeHOCRPage(&buf, "two.png", page)
+	out := buf.String()
+	if strings.Contains(out, ">hello world<") {
+		t.Errorf("writeHOCRPage emitted the aggregate entry as a word, got:\n%s", out)
+	}
+	if !strings.Contains(out, ">hello<") || !strings.Contains(out, ">world<") {
+		t.Errorf("writeHOCRPage missing expected words, got:\n%s", out)
+	}
+}
+
+func TestGroupPagesMultiPage(t *testing.T) {
+	// Regression test: words from different pages of a multi-page input
+	// (e.g. a multi-page TIFF) must end up in distinct pageResults, not
+	// flattened into one with colliding, page-local bounding boxes.
+	anns := []TextAnnotation{
+		{Description: "hello world", Page: 1},
+		{Description: "hello", Page: 1},
+		{Description: "world", Page: 1},
+		{Description: "foo bar", Page: 2},
+		{Description: "foo", Page: 2},
+		{Description: "bar", Page: 2},
+	}
+	pages := groupPages(anns)
+	if len(pages) != 2 {
+		t.Fatalf("groupPages returned %d pages, want 2: %+v", len(pages), pages)
+	}
+	if pages[0].Page != 1 || len(pages[0].Annotations) != 3 {
+		t.Errorf("pages[0] = %+v, want page 1 with 3 annotations", pages[0])
+	}
+	if pages[1].Page != 2 || len(pages[1].Annotations) != 3 {
+		t.Errorf("pages[1] = %+v, want page 2 with 3 annotations", pages[1])
+	}
+}
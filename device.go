@@ -0,0 +1,203 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// Supported values for -auth.
+const (
+	authInstalled = "installed"
+	authDevice    = "device"
+)
+
+// deviceCodeEndpoint and deviceTokenEndpoint are vars, not consts, so tests
+// can point them at an httptest.Server.
+var (
+	deviceCodeEndpoint  = "https://oauth2.googleapis.com/device/code"
+	deviceTokenEndpoint = "https://oauth2.googleapis.com/token"
+)
+
+// deviceCodeResponse is Google's response to a device authorization
+// request, as defined by RFC 8628. Error and ErrorDescription are set
+// instead of the other fields when the request is rejected (e.g. an
+// invalid client ID or scope).
+type deviceCodeResponse struct {
+	DeviceCode       string `json:"device_code"`
+	UserCode         string `json:"user_code"`
+	VerificationURL  string `json:"verification_url"`
+	ExpiresIn        int    `json:"expires_in"`
+	Interval         int    `json:"interval"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceTokenResponse is Google's response to a device token poll. Error
+// and ErrorDescription are set instead of AccessToken while authorization
+// is still pending, or when the poll is rejected outright.
+type deviceTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// getTokenFromDevice runs the OAuth 2.0 Device Authorization Grant (RFC
+// 8628): it asks Google for a device and user code, prints the user code
+// and verification URL for the operator to enter on another device, then
+// polls the token endpoint until they do. It returns the retrieved Token.
+func getTokenFromDevice(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	dcr, err := requestDeviceCode(ctx, config.ClientID, config.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain device code: %v", err)
+	}
+
+	fmt.Printf("To authorize ocr, go to %s and enter the code: %s\n", dcr.VerificationURL, dcr.UserCode)
+
+	return pollDeviceToken(ctx, config, dcr)
+}
+
+// requestDeviceCode asks Google's device authorization endpoint for a
+// device code and a user code to present to the operator.
+func requestDeviceCode(ctx context.Context, clientID string, scopes []string) (*deviceCodeResponse, error) {
+	form := url.Values{
+		"client_id": {clientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}
+	req, err := http.NewRequest("POST", deviceCodeEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var dcr deviceCodeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dcr); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if dcr.Error != "" {
+			return nil, fmt.Errorf("device code endpoint: %s: %s", dcr.Error, dcr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("device code endpoint returned status %s", resp.Status)
+	}
+	if dcr.DeviceCode == "" {
+		return nil, fmt.Errorf("device code endpoint returned no device_code (status %s)", resp.Status)
+	}
+	return &dcr, nil
+}
+
+// pollDeviceToken polls the token endpoint at the interval Google
+// requested until the operator has authorized the device, the device code
+// expires, or an unrecoverable error occurs.
+func pollDeviceToken(ctx context.Context, config *oauth2.Config, dcr *deviceCodeResponse) (*oauth2.Token, error) {
+	interval := time.Duration(dcr.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(dcr.ExpiresIn) * time.Second)
+
+	for {
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("device code expired before authorization completed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		dtr, err := requestDeviceToken(ctx, config, dcr.DeviceCode)
+		if err != nil {
+			return nil, err
+		}
+		switch dtr.Error {
+		case "":
+			if dtr.AccessToken == "" {
+				return nil, fmt.Errorf("device token endpoint returned neither an access_token nor an error")
+			}
+			return &oauth2.Token{
+				AccessToken:  dtr.AccessToken,
+				RefreshToken: dtr.RefreshToken,
+				TokenType:    dtr.TokenType,
+				Expiry:       time.Now().Add(time.Duration(dtr.ExpiresIn) * time.Second),
+			}, nil
+		case "authorization_pending":
+			// Keep polling at the same interval.
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, fmt.Errorf("authorization request was denied")
+		case "expired_token":
+			return nil, fmt.Errorf("device code expired before authorization completed")
+		default:
+			return nil, fmt.Errorf("unexpected error from device token endpoint: %s: %s", dtr.Error, dtr.ErrorDescription)
+		}
+	}
+}
+
+func requestDeviceToken(ctx context.Context, config *oauth2.Config, deviceCode string) (*deviceTokenResponse, error) {
+	form := url.Values{
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"device_code":   {deviceCode},
+		"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	req, err := http.NewRequest("POST", deviceTokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var dtr deviceTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dtr); err != nil {
+		return nil, err
+	}
+	// Google's device token endpoint legitimately reports pending/slow_down
+	// polling states with a non-200 status, so a non-200 status is only an
+	// error in itself when the body didn't also give us an error to report;
+	// otherwise dtr.Error flows through pollDeviceToken's state machine.
+	if resp.StatusCode != http.StatusOK && dtr.Error == "" {
+		return nil, fmt.Errorf("device token endpoint returned status %s with no error detail", resp.Status)
+	}
+	return &dtr, nil
+}
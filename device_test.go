@@ -0,0 +1,169 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// withDeviceTokenServer points deviceTokenEndpoint at a test server that
+// runs handler for every poll, and restores the original endpoint when the
+// test finishes.
+func withDeviceTokenServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	orig := deviceTokenEndpoint
+	deviceTokenEndpoint = srv.URL
+	t.Cleanup(func() { deviceTokenEndpoint = orig })
+}
+
+func writeTokenResponse(t *testing.T, w http.ResponseWriter, dtr deviceTokenResponse) {
+	t.Helper()
+	if err := json.NewEncoder(w).Encode(dtr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPollDeviceTokenSuccess(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{
+			AccessToken: "the-access-token",
+			TokenType:   "Bearer",
+			ExpiresIn:   3600,
+		})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	tok, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err != nil {
+		t.Fatalf("pollDeviceToken: %v", err)
+	}
+	if tok.AccessToken != "the-access-token" {
+		t.Errorf("AccessToken = %q, want %q", tok.AccessToken, "the-access-token")
+	}
+}
+
+func TestPollDeviceTokenEmptyAccessTokenRejected(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	if _, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr); err == nil {
+		t.Error("pollDeviceToken succeeded with an empty access token, want an error")
+	}
+}
+
+func TestPollDeviceTokenAuthorizationPending(t *testing.T) {
+	var calls int32
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			writeTokenResponse(t, w, deviceTokenResponse{Error: "authorization_pending"})
+			return
+		}
+		writeTokenResponse(t, w, deviceTokenResponse{AccessToken: "tok"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	tok, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err != nil {
+		t.Fatalf("pollDeviceToken: %v", err)
+	}
+	if tok.AccessToken != "tok" {
+		t.Errorf("AccessToken = %q, want %q", tok.AccessToken, "tok")
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("server got %d calls, want 2 (one pending, one success)", got)
+	}
+}
+
+func TestPollDeviceTokenSlowDown(t *testing.T) {
+	var calls int32
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			writeTokenResponse(t, w, deviceTokenResponse{Error: "slow_down"})
+			return
+		}
+		writeTokenResponse(t, w, deviceTokenResponse{AccessToken: "tok"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	tok, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err != nil {
+		t.Fatalf("pollDeviceToken: %v", err)
+	}
+	if tok.AccessToken != "tok" {
+		t.Errorf("AccessToken = %q, want %q", tok.AccessToken, "tok")
+	}
+}
+
+func TestPollDeviceTokenAccessDenied(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{Error: "access_denied"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("pollDeviceToken error = %v, want an access_denied error", err)
+	}
+}
+
+func TestPollDeviceTokenExpiredToken(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{Error: "expired_token"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("pollDeviceToken error = %v, want an expired_token error", err)
+	}
+}
+
+func TestPollDeviceTokenUnexpectedError(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{Error: "invalid_client", ErrorDescription: "bad client id"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 60}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") || !strings.Contains(err.Error(), "bad client id") {
+		t.Errorf("pollDeviceToken error = %v, want it to mention invalid_client and bad client id", err)
+	}
+}
+
+func TestPollDeviceTokenExpiresBeforeAuthorization(t *testing.T) {
+	withDeviceTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTokenResponse(t, w, deviceTokenResponse{Error: "authorization_pending"})
+	})
+
+	dcr := &deviceCodeResponse{DeviceCode: "dc", Interval: 1, ExpiresIn: 1}
+	_, err := pollDeviceToken(context.Background(), &oauth2.Config{}, dcr)
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("pollDeviceToken error = %v, want an expiry error", err)
+	}
+}
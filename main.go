@@ -17,14 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 
 	vision "cloud.google.com/go/vision/apiv1"
 	"golang.org/x/net/context"
@@ -34,9 +40,13 @@ import (
 )
 
 var (
-	flagServiceAccount = flag.String("service_account", "", "Path to a service account credentials file")
-	flagClientID       = flag.String("client_id", "", "Path to a client ID credentials file")
-	flagInput          = flag.String("input", "", "Path to an image with text to be OCRed")
+	flagServiceAccount = flag.String("service_account", "", "Path to a service account credentials file (google backend only)")
+	flagClientID       = flag.String("client_id", "", "Path to a client ID credentials file (google backend only)")
+	flagInput          = flag.String("input", "", "Path to an image, a directory of images, or a glob pattern to be OCRed")
+	flagOutput         = flag.String("output", outputText, "Output format for OCR results: text, json, or hocr")
+	flagConcurrency    = flag.Int("concurrency", 4, "Number of images to OCR concurrently when -input is a directory or glob")
+	flagBackend        = flag.String("backend", backendGoogle, "OCR backend to use: google, tesseract, or textract")
+	flagAuth           = flag.String("auth", authInstalled, "OAuth flow to use with -client_id: installed (browser redirect) or device (for headless machines)")
 )
 
 // getClient uses a Context and Config to retrieve a Token
@@ -48,22 +58,54 @@ func getToken(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error)
 	}
 	tok, err := tokenFromFile(cacheFile)
 	if err != nil {
-		tok = getTokenFromWeb(config)
+		switch *flagAuth {
+		case authDevice:
+			tok, err = getTokenFromDevice(ctx, config)
+		default:
+			tok = getTokenFromWeb(config)
+		}
+		if err != nil {
+			return nil, err
+		}
 		saveToken(cacheFile, tok)
 	}
 	return tok, nil
 }
 
-// getTokenFromWeb uses Config to request a Token.
-// It returns the retrieved Token.
+// getTokenFromWeb runs a local loopback OAuth callback server, opens the
+// consent URL in the user's browser, and waits for Google to redirect back
+// with the authorization code. It returns the retrieved Token.
 func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Unable to start local callback server: %v", err)
+	}
+	config.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+
+	state, err := randomState()
+	if err != nil {
+		log.Fatalf("Unable to generate state token: %v", err)
+	}
+
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", callbackHandler(state, codeCh, errCh))
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	fmt.Printf("Opening the following link in your browser to authorize ocr:\n%v\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Printf("Could not open browser automatically (%v), please open the link above manually.\n", err)
+	}
 
 	var code string
-	if _, err := fmt.Scan(&code); err != nil {
-		log.Fatalf("Unable to read authorization code %v", err)
+	select {
+	case code = <-codeCh:
+	case err := <-errCh:
+		log.Fatalf("Authorization failed: %v", err)
 	}
 
 	tok, err := config.Exchange(oauth2.NoContext, code)
@@ -73,6 +115,56 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 	return tok
 }
 
+// callbackHandler returns the /callback handler for getTokenFromWeb's local
+// server. It rejects requests whose state parameter doesn't match the one
+// generated for this authorization attempt (CSRF defense), then sends the
+// authorization code it received on codeCh, or any failure on errCh.
+func callbackHandler(state string, codeCh chan<- string, errCh chan<- error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("state"); got != state {
+			http.Error(w, "invalid state parameter", http.StatusBadRequest)
+			errCh <- fmt.Errorf("invalid state parameter: got %q, want %q", got, state)
+			return
+		}
+		if errParam := r.URL.Query().Get("error"); errParam != "" {
+			http.Error(w, "authorization failed", http.StatusBadRequest)
+			errCh <- fmt.Errorf("authorization error: %v", errParam)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "missing code parameter", http.StatusBadRequest)
+			errCh <- fmt.Errorf("callback request had no code parameter")
+			return
+		}
+		fmt.Fprint(w, "<html><body>Authorization successful, you can close this tab and return to ocr.</body></html>")
+		codeCh <- code
+	}
+}
+
+// randomState returns a random, URL-safe token suitable for use as the
+// OAuth2 state parameter to defend against CSRF.
+func randomState() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser attempts to open url in the user's default browser. It is
+// best-effort: callers should fall back to printing the URL on error.
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
+
 // tokenCacheFile generates credential file path/filename.
 // It returns the generated credential path/filename.
 func tokenCacheFile() (string, error) {
@@ -112,6 +204,20 @@ func visionClient(ctx context.Context) (*vision.ImageAnnotatorClient, error) {
 		return vision.NewImageAnnotatorClient(ctx, option.WithCredentialsFile(*flagServiceAccount))
 	}
 
+	if *flagClientID == "" {
+		// Neither -service_account nor -client_id was given: fall back to
+		// Application Default Credentials. This picks up
+		// GOOGLE_APPLICATION_CREDENTIALS, gcloud user credentials, the
+		// GCE/GKE metadata server, and external-account (workload identity
+		// federation) configs, so ocr works unattended in CI, Kubernetes,
+		// or on a developer workstation after `gcloud auth application-default login`.
+		creds, err := google.FindDefaultCredentials(ctx, scopeURLs...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find default credentials: %v", err)
+		}
+		return vision.NewImageAnnotatorClient(ctx, option.WithCredentials(creds))
+	}
+
 	b, err := ioutil.ReadFile(*flagClientID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read client id file: %v", err)
@@ -132,38 +238,39 @@ var scopeURLs = vision.DefaultAuthScopes()
 
 func main() {
 	flag.Parse()
-	if *flagServiceAccount == "" && *flagClientID == "" {
-		log.Fatalf("either -service_account or -client_id must be specified")
-	} else if *flagServiceAccount != "" && *flagClientID != "" {
+	if *flagBackend == backendGoogle && *flagServiceAccount != "" && *flagClientID != "" {
 		log.Fatalf("-service_account and -client_id are mutually exclusive")
 	}
 	if *flagInput == "" {
 		log.Fatalf("-input needs to be specified")
 	}
-	ctx := context.Background()
-
-	cl, err := visionClient(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+	switch *flagOutput {
+	case outputText, outputJSON, outputHOCR:
+	default:
+		log.Fatalf("invalid -output %q: must be one of %s, %s, %s", *flagOutput, outputText, outputJSON, outputHOCR)
+	}
+	switch *flagAuth {
+	case authInstalled, authDevice:
+	default:
+		log.Fatalf("invalid -auth %q: must be one of %s, %s", *flagAuth, authInstalled, authDevice)
 	}
 
-	file, err := os.Open(*flagInput)
+	files, err := listImages(*flagInput)
 	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+		log.Fatalf("Failed to list input images: %v", err)
 	}
-	defer file.Close()
-	image, err := vision.NewImageFromReader(file)
-	if err != nil {
-		log.Fatalf("Failed to create image entity: %v", err)
+	if len(files) == 0 {
+		log.Fatalf("no supported images found at %s", *flagInput)
 	}
 
-	texts, err := cl.DetectTexts(ctx, image, nil, -1)
+	ctx := context.Background()
+
+	backend, err := newBackend(ctx)
 	if err != nil {
-		log.Fatalf("Error detecting text: %v", err)
+		log.Fatalf("Failed to create %s backend: %v", *flagBackend, err)
 	}
 
-	fmt.Println("Text:")
-	for _, t := range texts {
-		fmt.Println(t.Description)
+	if err := runBatch(ctx, backend, files, *flagConcurrency, *flagOutput); err != nil {
+		log.Fatalf("%v", err)
 	}
 }
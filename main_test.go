@@ -0,0 +1,88 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallbackHandlerStateMismatch(t *testing.T) {
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	h := callbackHandler("want-state", codeCh, errCh)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/callback?state=got-state&code=abc", nil)
+	h(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	select {
+	case <-codeCh:
+		t.Error("callbackHandler sent a code for a mismatched state")
+	case err := <-errCh:
+		if err == nil {
+			t.Error("errCh got a nil error")
+		}
+	}
+}
+
+func TestCallbackHandlerMissingCode(t *testing.T) {
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	h := callbackHandler("state", codeCh, errCh)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/callback?state=state", nil)
+	h(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	select {
+	case <-codeCh:
+		t.Error("callbackHandler sent a code despite a missing code parameter")
+	case err := <-errCh:
+		if err == nil {
+			t.Error("errCh got a nil error")
+		}
+	}
+}
+
+func TestCallbackHandlerSuccess(t *testing.T) {
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	h := callbackHandler("state", codeCh, errCh)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/callback?state=state&code=the-code", nil)
+	h(w, r)
+
+	if w.Code != 200 {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	select {
+	case code := <-codeCh:
+		if code != "the-code" {
+			t.Errorf("codeCh got %q, want %q", code, "the-code")
+		}
+	case err := <-errCh:
+		t.Errorf("errCh got %v, want a code instead", err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// tesseractBackend is the OCRBackend that shells out to a local tesseract
+// binary, so ocr keeps working without any cloud credentials at all.
+type tesseractBackend struct {
+	bin string
+}
+
+func newTesseractBackend() (OCRBackend, error) {
+	bin, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, fmt.Errorf("tesseract backend: %v (is tesseract-ocr installed and on PATH?)", err)
+	}
+	return &tesseractBackend{bin: bin}, nil
+}
+
+func (b *tesseractBackend) Detect(ctx context.Context, r io.Reader) ([]TextAnnotation, error) {
+	tmp, err := ioutil.TempFile("", "ocr-tesseract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, copyErr := io.Copy(tmp, r)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		return nil, copyErr
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	// "stdout" as the output base name makes tesseract write the TSV
+	// straight to its standard output instead of a file.
+	cmd := exec.CommandContext(ctx, b.bin, tmp.Name(), "stdout", "tsv")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tesseract: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	words, err := parseTesseractTSV(&out)
+	if err != nil {
+		return nil, err
+	}
+	return withAggregatePerPage(words), nil
+}
+
+// parseTesseractTSV parses the `tesseract ... tsv` column output into one
+// TextAnnotation per recognized word, with Page set from page_num so
+// multi-page input (e.g. a multi-page TIFF) can be grouped back into
+// pages. The columns are: level, page_num, block_num, par_num, line_num,
+// word_num, left, top, width, height, conf, text.
+func parseTesseractTSV(r io.Reader) ([]TextAnnotation, error) {
+	var anns []TextAnnotation
+	sc := bufio.NewScanner(r)
+	header := true
+	for sc.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		cols := strings.Split(sc.Text(), "\t")
+		if len(cols) < 12 {
+			continue
+		}
+		text := strings.TrimSpace(cols[11])
+		if text == "" {
+			continue
+		}
+		page, _ := strconv.Atoi(cols[1])
+		left, _ := strconv.Atoi(cols[6])
+		top, _ := strconv.Atoi(cols[7])
+		width, _ := strconv.Atoi(cols[8])
+		height, _ := strconv.Atoi(cols[9])
+		conf, _ := strconv.ParseFloat(cols[10], 32)
+		anns = append(anns, TextAnnotation{
+			Description: text,
+			Confidence:  float32(conf) / 100,
+			BoundingBox: BoundingBox{Vertices: []Point{
+				{X: int32(left), Y: int32(top)},
+				{X: int32(left + width), Y: int32(top)},
+				{X: int32(left + width), Y: int32(top + height)},
+				{X: int32(left), Y: int32(top + height)},
+			}},
+			Page: page,
+		})
+	}
+	return anns, sc.Err()
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTesseractTSV(t *testing.T) {
+	const tsv = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"5\t1\t1\t1\t1\t1\t10\t20\t30\t15\t95.5\tHello\n" +
+		"5\t1\t1\t1\t1\t2\t45\t20\t20\t15\t80\tworld\n" +
+		"2\t1\t1\t1\t1\t0\t0\t0\t0\t0\t-1\t\n"
+
+	anns, err := parseTesseractTSV(strings.NewReader(tsv))
+	if err != nil {
+		t.Fatalf("parseTesseractTSV: %v", err)
+	}
+	if len(anns) != 2 {
+		t.Fatalf("got %d annotations, want 2: %+v", len(anns), anns)
+	}
+	if anns[0].Description != "Hello" || anns[1].Description != "world" {
+		t.Errorf("unexpected descriptions: %q, %q", anns[0].Description, anns[1].Description)
+	}
+	if got, want := anns[0].Confidence, float32(0.955); got != want {
+		t.Errorf("anns[0].Confidence = %v, want %v", got, want)
+	}
+	if anns[0].Page != 1 || anns[1].Page != 1 {
+		t.Errorf("anns Page = %d, %d, want 1, 1", anns[0].Page, anns[1].Page)
+	}
+
+	wantBox := BoundingBox{Vertices: []Point{{X: 10, Y: 20}, {X: 40, Y: 20}, {X: 40, Y: 35}, {X: 10, Y: 35}}}
+	if !reflect.DeepEqual(anns[0].BoundingBox, wantBox) {
+		t.Errorf("anns[0].BoundingBox = %+v, want %+v", anns[0].BoundingBox, wantBox)
+	}
+}
+
+func TestParseTesseractTSVNoWords(t *testing.T) {
+	const tsv = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"
+
+	anns, err := parseTesseractTSV(strings.NewReader(tsv))
+	if err != nil {
+		t.Fatalf("parseTesseractTSV: %v", err)
+	}
+	if len(anns) != 0 {
+		t.Errorf("parseTesseractTSV(header only) = %+v, want empty", anns)
+	}
+}
+
+func TestParseTesseractTSVMultiPage(t *testing.T) {
+	const tsv = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"5\t1\t1\t1\t1\t1\t10\t20\t30\t15\t95.5\tHello\n" +
+		"5\t2\t1\t1\t1\t1\t10\t20\t30\t15\t90\tfoo\n"
+
+	anns, err := parseTesseractTSV(strings.NewReader(tsv))
+	if err != nil {
+		t.Fatalf("parseTesseractTSV: %v", err)
+	}
+	if len(anns) != 2 {
+		t.Fatalf("got %d annotations, want 2: %+v", len(anns), anns)
+	}
+	if anns[0].Page != 1 || anns[1].Page != 2 {
+		t.Errorf("anns Page = %d, %d, want 1, 2", anns[0].Page, anns[1].Page)
+	}
+
+	pages := withAggregatePerPage(anns)
+	if len(pages) != 4 {
+		t.Fatalf("withAggregatePerPage(2 pages) returned %d annotations, want 4: %+v", len(pages), pages)
+	}
+	if pages[0].Page != 1 || pages[0].Description != "Hello" {
+		t.Errorf("pages[0] aggregate = %+v, want page 1 aggregate %q", pages[0], "Hello")
+	}
+	if pages[2].Page != 2 || pages[2].Description != "foo" {
+		t.Errorf("pages[2] aggregate = %+v, want page 2 aggregate %q", pages[2], "foo")
+	}
+}
+
+func TestWithAggregate(t *testing.T) {
+	words := []TextAnnotation{
+		{Description: "hello", BoundingBox: BoundingBox{Vertices: []Point{{X: 0, Y: 0}, {X: 10, Y: 10}}}},
+		{Description: "world", BoundingBox: BoundingBox{Vertices: []Point{{X: 20, Y: 5}, {X: 30, Y: 15}}}},
+	}
+
+	got := withAggregate(words)
+	if len(got) != 3 {
+		t.Fatalf("withAggregate(2 words) returned %d annotations, want 3: %+v", len(got), got)
+	}
+	if got[0].Description != "hello world" {
+		t.Errorf("aggregate Description = %q, want %q", got[0].Description, "hello world")
+	}
+	wantBox := BoundingBox{Vertices: []Point{{X: 0, Y: 0}, {X: 30, Y: 0}, {X: 30, Y: 15}, {X: 0, Y: 15}}}
+	if !reflect.DeepEqual(got[0].BoundingBox, wantBox) {
+		t.Errorf("aggregate BoundingBox = %+v, want %+v", got[0].BoundingBox, wantBox)
+	}
+	if !reflect.DeepEqual(got[1], words[0]) || !reflect.DeepEqual(got[2], words[1]) {
+		t.Errorf("withAggregate did not preserve the original words, got %+v", got[1:])
+	}
+}
+
+func TestWithAggregateEmpty(t *testing.T) {
+	if got := withAggregate(nil); len(got) != 0 {
+		t.Errorf("withAggregate(nil) = %+v, want empty", got)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The Camlistore Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/textract"
+	"golang.org/x/net/context"
+)
+
+// textractBackend is the OCRBackend backed by AWS Textract, for users
+// running ocr in AWS-native environments without Google credentials.
+type textractBackend struct {
+	cl *textract.Textract
+}
+
+func newTextractBackend(ctx context.Context) (OCRBackend, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("textract backend: %v", err)
+	}
+	return &textractBackend{cl: textract.New(sess)}, nil
+}
+
+func (b *textractBackend) Detect(ctx context.Context, r io.Reader) ([]TextAnnotation, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := b.cl.DetectDocumentTextWithContext(ctx, &textract.DetectDocumentTextInput{
+		Document: &textract.Document{Bytes: data},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var anns []TextAnnotation
+	for _, block := range out.Blocks {
+		if block.BlockType == nil || *block.BlockType != textract.BlockTypeWord {
+			continue
+		}
+		anns = append(anns, textAnnotationFromBlock(block))
+	}
+	return withAggregatePerPage(anns), nil
+}
+
+func textAnnotationFromBlock(block *textract.Block) TextAnnotation {
+	ann := TextAnnotation{Page: 1}
+	if block.Page != nil {
+		ann.Page = int(*block.Page)
+	}
+	if block.Text != nil {
+		ann.Description = *block.Text
+	}
+	if block.Confidence != nil {
+		ann.Confidence = float32(*block.Confidence) / 100
+	}
+	if block.Geometry == nil {
+		return ann
+	}
+	for _, p := range block.Geometry.Polygon {
+		var x, y float64
+		if p.X != nil {
+			x = *p.X
+		}
+		if p.Y != nil {
+			y = *p.Y
+		}
+		ann.BoundingBox.Vertices = append(ann.BoundingBox.Vertices, Point{X: int32(x), Y: int32(y)})
+	}
+	return ann
+}